@@ -0,0 +1,156 @@
+package stdiocmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Codec produces the Decoder/Encoder pair used to read and write messages over a particular
+// wire framing, so MessageServer (and RPCServer/RPCClient) can be pointed at plain stdio,
+// LSP-style header-framed pipes, length-prefixed sockets, or anything else expressible as
+// Decode(v interface{}) / Encode(v interface{}).
+type Codec interface {
+	NewDecoder(r io.Reader) Decoder
+	NewEncoder(w io.Writer) Encoder
+}
+
+// JSONCodec is the original framing stdiocmd has always used: messages are read and written
+// back to back with encoding/json, which decodes exactly one JSON value per call and tolerates
+// (without requiring) a newline between them. This is the default used by NewStdMessageServer.
+//
+// It is not safe for pipes where the child process's stdout can also carry plain log lines
+// interleaved with messages: json.Decoder keeps failing once it meets one. LSPCodec, whose Decode
+// reports a stray line without a header colon as an error and resumes at the next line, copes
+// with those; LengthPrefixedCodec does not, since it expects nothing but frames on the stream.
+type JSONCodec struct{}
+
+// NewDecoder implements Codec.
+func (JSONCodec) NewDecoder(r io.Reader) Decoder { return json.NewDecoder(r) }
+
+// NewEncoder implements Codec.
+func (JSONCodec) NewEncoder(w io.Writer) Encoder { return json.NewEncoder(w) }
+
+// LSPCodec frames each message with an LSP-style "Content-Length: N\r\n\r\n" header, the same
+// framing gopls and the jsonrpc2 packages it is built on use. Because the body is read by exact
+// byte count rather than by scanning for a delimiter, embedded newlines and other control bytes
+// in the payload never affect where a frame ends. Message values are still marshaled with encoding/json, so this does not make
+// arbitrary non-UTF-8 binary data round-trip; encode such data (e.g. base64) before sending it.
+type LSPCodec struct{}
+
+// NewDecoder implements Codec.
+func (LSPCodec) NewDecoder(r io.Reader) Decoder {
+	return &lspDecoder{r: bufio.NewReader(r)}
+}
+
+// NewEncoder implements Codec.
+func (LSPCodec) NewEncoder(w io.Writer) Encoder {
+	return &lspEncoder{w: w}
+}
+
+type lspDecoder struct {
+	r *bufio.Reader
+}
+
+func (d *lspDecoder) Decode(v interface{}) error {
+	contentLength := int64(-1)
+	for {
+		line, err := d.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("stdiocmd: malformed LSP header %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "content-length") {
+			n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return fmt.Errorf("stdiocmd: invalid Content-Length header %q: %w", line, err)
+			}
+			contentLength = n
+		}
+		// other headers, e.g. Content-Type, are read and ignored, as in LSP.
+	}
+	if contentLength < 0 {
+		return fmt.Errorf("stdiocmd: LSP frame missing Content-Length header")
+	}
+	body := make([]byte, contentLength)
+	if _, err := io.ReadFull(d.r, body); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+type lspEncoder struct {
+	w io.Writer
+}
+
+func (e *lspEncoder) Encode(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// LengthPrefixedCodec frames each message as a 4-byte big-endian length followed by exactly
+// that many bytes of JSON. It is the simplest framing that survives embedded newlines and other
+// control bytes, for transports where the LSP header style is unnecessary overhead. As with
+// LSPCodec, the body is still marshaled with encoding/json, so non-UTF-8 binary data must be
+// encoded (e.g. base64) by the caller before it is round-tripped.
+type LengthPrefixedCodec struct{}
+
+// NewDecoder implements Codec.
+func (LengthPrefixedCodec) NewDecoder(r io.Reader) Decoder {
+	return &lengthPrefixedDecoder{r: r}
+}
+
+// NewEncoder implements Codec.
+func (LengthPrefixedCodec) NewEncoder(w io.Writer) Encoder {
+	return &lengthPrefixedEncoder{w: w}
+}
+
+type lengthPrefixedDecoder struct {
+	r io.Reader
+}
+
+func (d *lengthPrefixedDecoder) Decode(v interface{}) error {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(d.r, lenBuf[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	body := make([]byte, n)
+	if _, err := io.ReadFull(d.r, body); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+type lengthPrefixedEncoder struct {
+	w io.Writer
+}
+
+func (e *lengthPrefixedEncoder) Encode(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(body)))
+	if _, err := e.w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err = e.w.Write(body)
+	return err
+}
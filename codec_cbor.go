@@ -0,0 +1,20 @@
+//go:build cbor
+
+package stdiocmd
+
+import (
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// CBORCodec encodes/decodes messages as CBOR instead of JSON. It is only compiled in when
+// built with `-tags cbor`, since it pulls in an external dependency that most users of this
+// package don't need.
+type CBORCodec struct{}
+
+// NewDecoder implements Codec.
+func (CBORCodec) NewDecoder(r io.Reader) Decoder { return cbor.NewDecoder(r) }
+
+// NewEncoder implements Codec.
+func (CBORCodec) NewEncoder(w io.Writer) Encoder { return cbor.NewEncoder(w) }
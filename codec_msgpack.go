@@ -0,0 +1,20 @@
+//go:build msgpack
+
+package stdiocmd
+
+import (
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackCodec encodes/decodes messages as msgpack instead of JSON. It is only compiled in
+// when built with `-tags msgpack`, since it pulls in an external dependency that most users of
+// this package don't need.
+type MsgpackCodec struct{}
+
+// NewDecoder implements Codec.
+func (MsgpackCodec) NewDecoder(r io.Reader) Decoder { return msgpack.NewDecoder(r) }
+
+// NewEncoder implements Codec.
+func (MsgpackCodec) NewEncoder(w io.Writer) Encoder { return msgpack.NewEncoder(w) }
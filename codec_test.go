@@ -0,0 +1,47 @@
+package stdiocmd
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func testCodecRoundTrip(t *testing.T, codec Codec) {
+	t.Helper()
+
+	msgs := []Message{
+		{"text": "line one\nline two\r\nline three"},
+		{"control": "\x00\x01\x02\x1f\x7f"},
+	}
+
+	var buf bytes.Buffer
+	enc := codec.NewEncoder(&buf)
+	for _, m := range msgs {
+		if err := enc.Encode(m); err != nil {
+			t.Fatalf("Encode() error: %v", err)
+		}
+	}
+
+	dec := codec.NewDecoder(&buf)
+	for i, want := range msgs {
+		var got Message
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("Decode() message %d error: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("message %d round-tripped wrong: got %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestLSPCodecRoundTrip(t *testing.T) {
+	testCodecRoundTrip(t, LSPCodec{})
+}
+
+func TestLengthPrefixedCodecRoundTrip(t *testing.T) {
+	testCodecRoundTrip(t, LengthPrefixedCodec{})
+}
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+	testCodecRoundTrip(t, JSONCodec{})
+}
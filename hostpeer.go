@@ -0,0 +1,323 @@
+package stdiocmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// HostPeer is the symmetric client-side counterpart to NewStdPeer: it launches a child binary
+// via os/exec, wires its stdin/stdout into the embedded Peer, and streams its stderr through a
+// LogCapture forwarded as "log" notifications on that same Peer, so the Electron/host side can
+// write host.Call(ctx, "startWebserver", params, &reply) without hand-rolling exec plumbing.
+// It also restarts the child with backoff if it exits unexpectedly, and knows how to shut it
+// down gracefully.
+type HostPeer struct {
+	*Peer
+
+	// Command builds the child's *exec.Cmd; called each time the child is (re)started, since
+	// an *exec.Cmd cannot be reused after it has exited.
+	Command func() *exec.Cmd
+
+	// Codec frames the wire format used to talk to the child; defaults to JSONCodec{}.
+	Codec Codec
+
+	// LogCapture streams the child's stderr; if nil, Run creates one that forwards each line
+	// as a "log" notification on the embedded Peer.
+	LogCapture *LogCapture
+
+	// RestartBackoff computes how long to wait before restarting the child after its attempt'th
+	// consecutive exit (attempt starting at 1). Defaults to defaultRestartBackoff, which
+	// doubles from 1s up to a cap of 30s.
+	RestartBackoff func(attempt int) time.Duration
+
+	// ShutdownTimeout bounds how long Shutdown waits for the child to exit on its own before
+	// sending SIGTERM, and after SIGTERM before sending SIGKILL. Defaults to 5s.
+	ShutdownTimeout time.Duration
+
+	mu         sync.Mutex
+	cmd        *exec.Cmd
+	exited     chan struct{}
+	exitErr    error
+	stopping   bool
+	ready      bool
+	readyCh    chan struct{}
+	outEncoder Encoder
+	inDecoder  Decoder
+}
+
+// errChildNotConnected is returned by Call/Notify/Ping when there is no child process currently
+// wired up to read from or write to, e.g. before Run's first child has started, or during the
+// gap between one child exiting and the next being started.
+var errChildNotConnected = fmt.Errorf("stdiocmd: child process not connected")
+
+// hostPeerEncoder is installed as the embedded Peer's OutEncoder so that Call/Notify (called from
+// arbitrary goroutines, possibly while a restart is in progress) never see a nil or
+// concurrently-mutated Encoder: it forwards to hp's current outEncoder under hp.mu, or reports
+// errChildNotConnected if there isn't one.
+type hostPeerEncoder struct{ hp *HostPeer }
+
+func (e *hostPeerEncoder) Encode(v interface{}) error {
+	e.hp.mu.Lock()
+	enc := e.hp.outEncoder
+	e.hp.mu.Unlock()
+	if enc == nil {
+		return errChildNotConnected
+	}
+	return enc.Encode(v)
+}
+
+// hostPeerDecoder is the InDecoder counterpart to hostPeerEncoder.
+type hostPeerDecoder struct{ hp *HostPeer }
+
+func (d *hostPeerDecoder) Decode(v interface{}) error {
+	d.hp.mu.Lock()
+	dec := d.hp.inDecoder
+	d.hp.mu.Unlock()
+	if dec == nil {
+		return errChildNotConnected
+	}
+	return dec.Decode(v)
+}
+
+// ensureWrapped makes sure hp.Peer is non-nil and its InDecoder/OutEncoder are the hostPeerDecoder/
+// hostPeerEncoder wrappers, so runOnce can swap the real codec underneath them without racing a
+// concurrent Call/Notify/Ping.
+func (hp *HostPeer) ensureWrapped() {
+	if hp.Peer == nil {
+		hp.Peer = &Peer{}
+	}
+	if _, ok := hp.Peer.OutEncoder.(*hostPeerEncoder); !ok {
+		hp.Peer.OutEncoder = &hostPeerEncoder{hp: hp}
+	}
+	if _, ok := hp.Peer.InDecoder.(*hostPeerDecoder); !ok {
+		hp.Peer.InDecoder = &hostPeerDecoder{hp: hp}
+	}
+}
+
+// WaitReady blocks until the current (or next) child process has been launched and wired to
+// the Peer, so that Call/Notify/Ping are safe to use, or until ctx is done.
+func (hp *HostPeer) WaitReady(ctx context.Context) error {
+	hp.mu.Lock()
+	if hp.ready {
+		hp.mu.Unlock()
+		return nil
+	}
+	if hp.readyCh == nil {
+		hp.readyCh = make(chan struct{})
+	}
+	ch := hp.readyCh
+	hp.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewHostPeer returns a HostPeer that launches command() as its child process.
+func NewHostPeer(command func() *exec.Cmd) *HostPeer {
+	hp := &HostPeer{Command: command}
+	hp.ensureWrapped()
+	return hp
+}
+
+// Ping blocks until the child responds to a "ping" call or ctx is done, as a basic health check.
+func (hp *HostPeer) Ping(ctx context.Context) error {
+	return hp.Call(ctx, "ping", nil, nil)
+}
+
+// Run launches the child process and supervises it: if it exits before Shutdown is called, Run
+// restarts it after RestartBackoff and keeps going. It returns nil once the child exits after
+// Shutdown has been called, or ctx.Err() once ctx is done. ctx is only checked after a child has
+// exited and during the restart backoff; a running child is not stopped when ctx is done.
+func (hp *HostPeer) Run(ctx context.Context) error {
+	hp.ensureWrapped()
+	if hp.LogCapture == nil {
+		hp.LogCapture = &LogCapture{Writer: &PeerNotifyWriter{Peer: hp.Peer, Method: "log"}}
+	}
+	codec := hp.codec()
+
+	for attempt := 1; ; attempt++ {
+		if err := hp.runOnce(codec); err != nil {
+			log.Printf("HostPeer: child process exited: %v", err)
+		}
+
+		hp.mu.Lock()
+		stopping := hp.stopping
+		hp.mu.Unlock()
+		if stopping {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		backoff := hp.backoffFor(attempt)
+		log.Printf("HostPeer: restarting child process in %s", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// runOnce launches the child once, wires it to the Peer and LogCapture, and blocks until
+// either the wire connection or the process itself ends.
+func (hp *HostPeer) runOnce(codec Codec) error {
+	cmd := hp.Command()
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	serveDone := make(chan struct{})
+	hp.mu.Lock()
+	hp.cmd = cmd
+	hp.exited = exited
+	hp.mu.Unlock()
+
+	go func() {
+		// cmd.Wait closes stdout, so it must not run until Serve has read it to EOF.
+		<-serveDone
+		err := cmd.Wait()
+		hp.mu.Lock()
+		hp.exitErr = err
+		hp.mu.Unlock()
+		close(exited)
+	}()
+
+	hp.mu.Lock()
+	hp.inDecoder = codec.NewDecoder(stdout)
+	hp.outEncoder = &SyncEncoder{Encoder: codec.NewEncoder(stdin)}
+	hp.ready = true
+	readyCh := hp.readyCh
+	hp.readyCh = nil
+	hp.mu.Unlock()
+	if readyCh != nil {
+		close(readyCh)
+	}
+
+	go hp.LogCapture.Run(stderr)
+
+	serveErr := hp.Peer.Serve()
+	close(serveDone)
+	hp.Peer.Wait()
+	<-exited
+
+	hp.mu.Lock()
+	waitErr := hp.exitErr
+	hp.cmd = nil
+	hp.exited = nil
+	hp.ready = false
+	hp.inDecoder = nil
+	hp.outEncoder = nil
+	hp.mu.Unlock()
+
+	if waitErr != nil {
+		return waitErr
+	}
+	return serveErr
+}
+
+// Shutdown asks the child to exit gracefully: it sends a "shutdown" notification and waits up
+// to ShutdownTimeout for the process to exit on its own, then escalates to SIGTERM (given another
+// ShutdownTimeout to take effect) and finally SIGKILL, returning right after sending it, if it
+// doesn't. It also stops Run from
+// restarting the child once this exit is observed.
+func (hp *HostPeer) Shutdown(ctx context.Context) error {
+	hp.mu.Lock()
+	hp.stopping = true
+	cmd := hp.cmd
+	exited := hp.exited
+	hp.mu.Unlock()
+
+	if cmd == nil || exited == nil {
+		return nil
+	}
+
+	if err := hp.Notify("shutdown", nil); err != nil {
+		log.Printf("HostPeer: error sending shutdown notification: %v", err)
+	}
+
+	timeout := hp.shutdownTimeout()
+
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(timeout):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		log.Printf("HostPeer: error sending SIGTERM: %v", err)
+	}
+
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(timeout):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return cmd.Process.Kill()
+}
+
+func (hp *HostPeer) shutdownTimeout() time.Duration {
+	if hp.ShutdownTimeout > 0 {
+		return hp.ShutdownTimeout
+	}
+	return 5 * time.Second
+}
+
+func (hp *HostPeer) codec() Codec {
+	if hp.Codec != nil {
+		return hp.Codec
+	}
+	return JSONCodec{}
+}
+
+func (hp *HostPeer) backoffFor(attempt int) time.Duration {
+	if hp.RestartBackoff != nil {
+		return hp.RestartBackoff(attempt)
+	}
+	return defaultRestartBackoff(attempt)
+}
+
+// defaultRestartBackoff doubles from 1s up to a cap of 30s as attempt increases.
+func defaultRestartBackoff(attempt int) time.Duration {
+	d := time.Second
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= 30*time.Second {
+			return 30 * time.Second
+		}
+	}
+	return d
+}
@@ -0,0 +1,96 @@
+package stdiocmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess is not a real test; it is re-exec'd as a child process by
+// TestHostPeerPingAndShutdown, following the same pattern os/exec_test.go uses. It runs a Peer
+// over its own stdin/stdout that responds to "ping" and exits when told to "shutdown".
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("STDIOCMD_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	p := &Peer{
+		InDecoder:  json.NewDecoder(os.Stdin),
+		OutEncoder: &SyncEncoder{Encoder: json.NewEncoder(os.Stdout)},
+	}
+	p.Register("ping", func(ctx context.Context, _ struct{}) (struct{}, error) {
+		return struct{}{}, nil
+	})
+	p.Register("shutdown", func(ctx context.Context, _ struct{}) (struct{}, error) {
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			os.Exit(0)
+		}()
+		return struct{}{}, nil
+	})
+	p.Serve()
+}
+
+func helperProcessCommand() func() *exec.Cmd {
+	return func() *exec.Cmd {
+		cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess", "--")
+		cmd.Env = append(os.Environ(), "STDIOCMD_WANT_HELPER_PROCESS=1")
+		return cmd
+	}
+}
+
+func TestHostPeerNotifyBeforeRun(t *testing.T) {
+	hp := NewHostPeer(helperProcessCommand())
+
+	if err := hp.Notify("ping", nil); err == nil {
+		t.Fatal("Notify() before Run() returned nil error, want errChildNotConnected")
+	}
+
+	pctx, pcancel := context.WithTimeout(context.Background(), time.Second)
+	defer pcancel()
+	if err := hp.Ping(pctx); err == nil {
+		t.Fatal("Ping() before Run() returned nil error, want errChildNotConnected")
+	}
+}
+
+func TestHostPeerPingAndShutdown(t *testing.T) {
+
+	hp := NewHostPeer(helperProcessCommand())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runErrCh := make(chan error, 1)
+	go func() { runErrCh <- hp.Run(ctx) }()
+
+	rctx, rcancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer rcancel()
+	if err := hp.WaitReady(rctx); err != nil {
+		t.Fatalf("WaitReady() error: %v", err)
+	}
+
+	pctx, pcancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer pcancel()
+	if err := hp.Ping(pctx); err != nil {
+		t.Fatalf("Ping() error: %v", err)
+	}
+
+	sctx, scancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer scancel()
+	if err := hp.Shutdown(sctx); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+
+	select {
+	case err := <-runErrCh:
+		if err != nil {
+			t.Fatalf("Run() returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after Shutdown()")
+	}
+}
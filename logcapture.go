@@ -0,0 +1,188 @@
+package stdiocmd
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LogMessageType is the Message "type" value LogCapture uses for forwarded log lines and
+// collated panic/stack traces.
+const LogMessageType = "log"
+
+// LogLevel is the severity attached to a forwarded log line. Captured text doesn't carry a
+// level on the wire, so LogCapture infers one heuristically.
+type LogLevel string
+
+// Log levels used by LogCapture.
+const (
+	LogLevelInfo  LogLevel = "info"
+	LogLevelError LogLevel = "error"
+	LogLevelPanic LogLevel = "panic"
+)
+
+// StackFrame is one parsed frame of a collated Go panic/stack trace.
+type StackFrame struct {
+	Function string `json:"function"`
+	Args     string `json:"args,omitempty"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// StackTrace is the parsed form of a single "goroutine N [state]:" block and the frames under it.
+type StackTrace struct {
+	Goroutine int          `json:"goroutine"`
+	State     string       `json:"state"`
+	Frames    []StackFrame `json:"frames"`
+}
+
+var (
+	goroutineHeaderRe = regexp.MustCompile(`^goroutine (\d+) \[([^\]]+)\]:$`)
+	stackFuncLineRe   = regexp.MustCompile(`^(\S+)\((.*)\)$`)
+	stackFileLineRe   = regexp.MustCompile(`^\t(.+):(\d+)(?:\s+.*)?$`)
+)
+
+// LogCapture reads line-oriented text -- typically a child process's stderr, or anything the
+// log package might write -- and forwards it to a MessageWriter as structured LogMessageType
+// Messages, so it can be displayed in an Electron (or other) UI instead of disappearing into a
+// hidden pipe. Plain lines are forwarded one at a time. A Go panic is detected by its
+// "goroutine N [state]:" header and collated, together with the stack frames beneath it, into a
+// single message carrying parsed StackFrames instead of being split across dozens of lines.
+type LogCapture struct {
+	Writer MessageWriter
+
+	// Type overrides the Message "type" value; defaults to LogMessageType if empty.
+	Type string
+
+	wg sync.WaitGroup
+}
+
+// NewLogCapture returns a LogCapture that forwards to w.
+func NewLogCapture(w MessageWriter) *LogCapture {
+	return &LogCapture{Writer: w}
+}
+
+// Run reads lines from r until EOF (or another read error), forwarding each to Writer. It
+// blocks until r is exhausted, so callers typically run it in its own goroutine against a child
+// process's stderr pipe.
+func (lc *LogCapture) Run(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var pendingPanic string
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if header := goroutineHeaderRe.FindStringSubmatch(line); header != nil {
+			goroutine, _ := strconv.Atoi(header[1])
+			trace := &StackTrace{
+				Goroutine: goroutine,
+				State:     header[2],
+				Frames:    collateStackFrames(scanner),
+			}
+			msg := pendingPanic
+			if msg == "" {
+				msg = line
+			}
+			pendingPanic = ""
+			lc.emit(LogLevelPanic, msg, trace)
+			continue
+		}
+
+		if pendingPanic != "" {
+			if strings.TrimSpace(line) == "" {
+				// panic/stack traces conventionally have a blank line between the
+				// "panic: ..." line and the "goroutine N [state]:" header; wait for it.
+				continue
+			}
+			lc.emit(LogLevelError, pendingPanic, nil)
+			pendingPanic = ""
+		}
+
+		if strings.HasPrefix(line, "panic:") {
+			pendingPanic = line
+			continue
+		}
+
+		lc.emit(levelForLine(line), line, nil)
+	}
+	if pendingPanic != "" {
+		lc.emit(LogLevelError, pendingPanic, nil)
+	}
+	return scanner.Err()
+}
+
+// collateStackFrames consumes frame/file:line pairs off scanner until a blank line or EOF,
+// as they appear under a "goroutine N [state]:" header.
+func collateStackFrames(scanner *bufio.Scanner) []StackFrame {
+	var frames []StackFrame
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		funcMatch := stackFuncLineRe.FindStringSubmatch(line)
+		if funcMatch == nil {
+			continue
+		}
+		if !scanner.Scan() {
+			break
+		}
+		fileMatch := stackFileLineRe.FindStringSubmatch(scanner.Text())
+		if fileMatch == nil {
+			continue
+		}
+		lineNum, _ := strconv.Atoi(fileMatch[2])
+		frames = append(frames, StackFrame{
+			Function: funcMatch[1],
+			Args:     funcMatch[2],
+			File:     fileMatch[1],
+			Line:     lineNum,
+		})
+	}
+	return frames
+}
+
+// levelForLine heuristically assigns a LogLevel to a plain (non-panic) line.
+func levelForLine(line string) LogLevel {
+	if strings.Contains(strings.ToLower(line), "error") {
+		return LogLevelError
+	}
+	return LogLevelInfo
+}
+
+func (lc *LogCapture) emit(level LogLevel, msg string, stack *StackTrace) {
+	t := lc.Type
+	if t == "" {
+		t = LogMessageType
+	}
+	m := Message{"type": t, "level": string(level), "msg": msg}
+	if stack != nil {
+		m["stack"] = stack
+	}
+	if err := lc.Writer.WriteMessage(m); err != nil {
+		log.Printf("LogCapture got error while forwarding message: %v", err)
+	}
+}
+
+// LogWriter returns an io.Writer that feeds everything written to it through Run, the same as
+// capturing a child process's stderr. This lets LogCapture also forward the log package's
+// output: log.SetOutput(lc.LogWriter()).
+func (lc *LogCapture) LogWriter() io.Writer {
+	pr, pw := io.Pipe()
+	lc.wg.Add(1)
+	go func() {
+		defer lc.wg.Done()
+		lc.Run(pr)
+	}()
+	return pw
+}
+
+// Wait blocks until all goroutines started by LogWriter() have exited.
+func (lc *LogCapture) Wait() {
+	lc.wg.Wait()
+}
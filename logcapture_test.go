@@ -0,0 +1,68 @@
+package stdiocmd
+
+import (
+	"strings"
+	"testing"
+)
+
+type collectingMessageWriter struct {
+	messages []Message
+}
+
+func (c *collectingMessageWriter) WriteMessage(m Message) error {
+	c.messages = append(c.messages, m)
+	return nil
+}
+
+func TestLogCaptureRun(t *testing.T) {
+
+	w := &collectingMessageWriter{}
+	lc := NewLogCapture(w)
+
+	input := strings.Join([]string{
+		`starting up`,
+		`panic: something went wrong`,
+		``,
+		`goroutine 1 [running]:`,
+		`main.doStuff(0x1, 0x2)`,
+		"\t/app/main.go:42 +0x1a",
+		`main.main()`,
+		"\t/app/main.go:10 +0x25",
+		``,
+		`exit status 2`,
+	}, "\n")
+
+	if err := lc.Run(strings.NewReader(input)); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	if len(w.messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d: %+v", len(w.messages), w.messages)
+	}
+
+	if w.messages[0]["msg"] != "starting up" {
+		t.Fatalf("expected first message to be the plain log line, got %+v", w.messages[0])
+	}
+
+	panicMsg := w.messages[1]
+	if panicMsg["type"] != LogMessageType || panicMsg["level"] != string(LogLevelPanic) {
+		t.Fatalf("expected a collated panic message, got %+v", panicMsg)
+	}
+	if panicMsg["msg"] != "panic: something went wrong" {
+		t.Fatalf("expected panic message text preserved, got %+v", panicMsg)
+	}
+	trace, ok := panicMsg["stack"].(*StackTrace)
+	if !ok {
+		t.Fatalf("expected stack to be a *StackTrace, got %T", panicMsg["stack"])
+	}
+	if len(trace.Frames) != 2 {
+		t.Fatalf("expected 2 parsed frames, got %d: %+v", len(trace.Frames), trace.Frames)
+	}
+	if trace.Frames[0].Function != "main.doStuff" || trace.Frames[0].Line != 42 {
+		t.Fatalf("unexpected first frame: %+v", trace.Frames[0])
+	}
+
+	if w.messages[2]["msg"] != "exit status 2" {
+		t.Fatalf("expected trailing line to be forwarded as its own message, got %+v", w.messages[2])
+	}
+}
@@ -0,0 +1,120 @@
+package stdiocmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// Middleware wraps a MessageHandler to add cross-cutting behavior -- logging, panic recovery,
+// auth-token checking, request-id tagging, rate limiting -- the same shape net/http middleware
+// uses for http.Handler.
+type Middleware func(next MessageHandler) MessageHandler
+
+// Mux dispatches an incoming Message to a registered handler based on the string value of a
+// field (MethodField, "method" by default), the same role http.ServeMux plays for paths. It
+// turns the single giant-switch MessageHandler design MessageServer otherwise forces into
+// something that scales to dozens of negotiation methods.
+type Mux struct {
+	// MethodField is the Message key used to select a handler; defaults to "method".
+	MethodField string
+
+	handlers   map[string]MessageHandler
+	middleware []Middleware
+}
+
+// NewMux returns an empty Mux.
+func NewMux() *Mux {
+	return &Mux{}
+}
+
+// Use appends mw to the middleware chain applied to every handler registered by a later call to
+// Handle or HandleFunc. As with net/http middleware, call Use before registering the handlers
+// it should wrap.
+func (mux *Mux) Use(mw Middleware) {
+	mux.middleware = append(mux.middleware, mw)
+}
+
+// Handle registers h as the MessageHandler for method, wrapped by the middleware chain
+// registered so far via Use.
+func (mux *Mux) Handle(method string, h MessageHandler) {
+	for i := len(mux.middleware) - 1; i >= 0; i-- {
+		h = mux.middleware[i](h)
+	}
+	if mux.handlers == nil {
+		mux.handlers = make(map[string]MessageHandler)
+	}
+	mux.handlers[method] = h
+}
+
+// HandleFunc registers fn, which must be a func(context.Context, ParamsT) (ResultT, error), as
+// the handler for method. The incoming Message is reflect-unmarshaled (via JSON, same as
+// RPCServer.Register) into ParamsT, and the returned ResultT is written back as the "result"
+// field of a reply Message, so handlers work with typed params/results directly instead of
+// poking at a Message map.
+func (mux *Mux) HandleFunc(method string, fn interface{}) {
+	h := newRPCHandlerEntry(method, fn)
+	mux.Handle(method, MessageHandlerFunc(func(w MessageWriter, m Message) {
+		rawParams, err := json.Marshal(m)
+		if err != nil {
+			w.WriteMessage(Message{"error": err.Error()})
+			return
+		}
+		result, rpcErr := callRPCHandler(context.Background(), h, rawParams)
+		if rpcErr != nil {
+			w.WriteMessage(Message{"error": rpcErr.Message, "code": rpcErr.Code})
+			return
+		}
+		w.WriteMessage(Message{"result": result})
+	}))
+}
+
+func (mux *Mux) methodField() string {
+	if mux.MethodField != "" {
+		return mux.MethodField
+	}
+	return "method"
+}
+
+// HandleMessage implements MessageHandler, dispatching m to the handler registered for
+// m[mux.MethodField], or writing a "method not found" error reply if there isn't one.
+func (mux *Mux) HandleMessage(w MessageWriter, m Message) {
+	method, _ := m[mux.methodField()].(string)
+	h, found := mux.handlers[method]
+	if !found {
+		w.WriteMessage(Message{"error": fmt.Sprintf("method not found: %s", method)})
+		return
+	}
+	h.HandleMessage(w, m)
+}
+
+// RecoverMiddleware returns a Middleware that recovers from a panic in next and logs it,
+// mirroring the recovery MessageServer.Serve hardcodes for every message today. Mux does not
+// recover panics in handlers registered with Handle on its own, so register this explicitly if
+// you want that behavior. (Handlers registered with HandleFunc already have a panic recovered and
+// answered with an "error" reply.)
+func RecoverMiddleware() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return MessageHandlerFunc(func(w MessageWriter, m Message) {
+			defer func() {
+				if r := recover(); r != nil {
+					st := debug.Stack()
+					log.Printf("Caught panic in Mux: %v\n%s", r, st)
+				}
+			}()
+			next.HandleMessage(w, m)
+		})
+	}
+}
+
+// LoggingMiddleware returns a Middleware that logs each incoming Message before passing it to next.
+func LoggingMiddleware() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return MessageHandlerFunc(func(w MessageWriter, m Message) {
+			log.Printf("Mux: got message: %+v", m)
+			next.HandleMessage(w, m)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package stdiocmd
+
+import (
+	"context"
+	"testing"
+)
+
+type recordingMessageWriter struct {
+	messages []Message
+}
+
+func (r *recordingMessageWriter) WriteMessage(m Message) error {
+	r.messages = append(r.messages, m)
+	return nil
+}
+
+func TestMuxHandleFunc(t *testing.T) {
+
+	var order []string
+
+	mux := NewMux()
+	mux.Use(func(next MessageHandler) MessageHandler {
+		return MessageHandlerFunc(func(w MessageWriter, m Message) {
+			order = append(order, "first")
+			next.HandleMessage(w, m)
+		})
+	})
+	mux.Use(func(next MessageHandler) MessageHandler {
+		return MessageHandlerFunc(func(w MessageWriter, m Message) {
+			order = append(order, "second")
+			next.HandleMessage(w, m)
+		})
+	})
+	mux.HandleFunc("echo", func(ctx context.Context, p echoParams) (echoResult, error) {
+		order = append(order, "handler")
+		return echoResult{Text: p.Text}, nil
+	})
+
+	w := &recordingMessageWriter{}
+	mux.HandleMessage(w, Message{"method": "echo", "text": "hi"})
+
+	if len(order) != 3 || order[0] != "first" || order[1] != "second" || order[2] != "handler" {
+		t.Fatalf("unexpected middleware order: %v", order)
+	}
+	if len(w.messages) != 1 {
+		t.Fatalf("expected 1 reply, got %d", len(w.messages))
+	}
+	result, ok := w.messages[0]["result"].(echoResult)
+	if !ok || result.Text != "hi" {
+		t.Fatalf("unexpected reply: %+v", w.messages[0])
+	}
+}
+
+func TestMuxMethodNotFound(t *testing.T) {
+
+	mux := NewMux()
+	w := &recordingMessageWriter{}
+	mux.HandleMessage(w, Message{"method": "nope"})
+
+	if len(w.messages) != 1 {
+		t.Fatalf("expected 1 reply, got %d", len(w.messages))
+	}
+	if _, ok := w.messages[0]["error"]; !ok {
+		t.Fatalf("expected an error reply, got %+v", w.messages[0])
+	}
+}
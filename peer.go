@@ -0,0 +1,305 @@
+package stdiocmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// cancelMethod is the well-known notification method a Peer sends to ask the other side to
+// cancel an in-flight call, the same $/cancelRequest convention LSP uses.
+const cancelMethod = "$/cancelRequest"
+
+// cancelParams is the payload of a cancelMethod notification.
+type cancelParams struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// peerEnvelope is decoded once per incoming wire message and covers both shapes a Peer may
+// receive: a request/notification (Method set) or a reply to one of our own outstanding calls
+// (Method empty, Result or Error set).
+type peerEnvelope struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Peer is a bidirectional JSON-RPC 2.0 connection: unlike RPCServer/RPCClient, where one side
+// only ever receives calls and the other only ever makes them, either side of a Peer may
+// initiate a call at any time (e.g. a server pushing "webserver ready on port X, here is the
+// cookie" to its Electron host without having been asked). Each incoming call is dispatched
+// with a context.Context that Peer cancels if a matching $/cancelRequest notification arrives
+// before the handler returns.
+//
+// OutEncoder should typically be wrapped in a SyncEncoder: a Peer writes to it both to reply to
+// incoming calls and to make its own outgoing calls/notifications, concurrently from multiple
+// goroutines.
+type Peer struct {
+	InDecoder  Decoder
+	OutEncoder Encoder
+
+	nextID int64
+
+	mu       sync.Mutex
+	handlers map[string]rpcHandlerEntry
+	pending  map[string]chan rpcResponse
+
+	cancelMu sync.Mutex
+	cancels  map[string]context.CancelFunc
+
+	wg sync.WaitGroup
+}
+
+// NewStdPeer returns a Peer connected to stdin and stdout, framed as line-delimited JSON.
+func NewStdPeer() *Peer {
+	return NewStdPeerWithCodec(JSONCodec{})
+}
+
+// NewStdPeerWithCodec returns a Peer connected to stdin and stdout, framed according to codec.
+func NewStdPeerWithCodec(codec Codec) *Peer {
+	return &Peer{
+		InDecoder:  codec.NewDecoder(os.Stdin),
+		OutEncoder: &SyncEncoder{Encoder: codec.NewEncoder(os.Stdout)},
+	}
+}
+
+// PeerNotifyWriter adapts a Peer to the MessageWriter interface by sending each Message as a
+// notification for Method, so things like LogCapture can forward onto a Peer's connection
+// instead of a plain Encoder.
+type PeerNotifyWriter struct {
+	Peer   *Peer
+	Method string
+}
+
+// WriteMessage implements MessageWriter.
+func (w *PeerNotifyWriter) WriteMessage(m Message) error {
+	return w.Peer.Notify(w.Method, m)
+}
+
+// Register adds a handler for method, following the same func(context.Context, ParamsT)
+// (ResultT, error) shape as RPCServer.Register.
+func (p *Peer) Register(method string, fn interface{}) {
+	h := newRPCHandlerEntry(method, fn)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handlers == nil {
+		p.handlers = make(map[string]rpcHandlerEntry)
+	}
+	p.handlers[method] = h
+}
+
+// Wait blocks until all goroutines started by Serve() have exited.
+func (p *Peer) Wait() {
+	p.wg.Wait()
+}
+
+// Call sends method/params as a JSON-RPC 2.0 request and blocks until a reply with the matching
+// id is read by Serve, unmarshaling the result into result (which should be a pointer, as with
+// json.Unmarshal), or until ctx is done. If ctx is done first, Call sends a $/cancelRequest
+// notification for this call's id before returning ctx.Err().
+func (p *Peer) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	id := strconv.FormatInt(atomic.AddInt64(&p.nextID, 1), 10)
+	rawID := json.RawMessage(strconv.Quote(id))
+	ch := make(chan rpcResponse, 1)
+
+	p.mu.Lock()
+	if p.pending == nil {
+		p.pending = make(map[string]chan rpcResponse)
+	}
+	p.pending[id] = ch
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	if err := p.send(method, params, rawID); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	case <-ctx.Done():
+		if err := p.send(cancelMethod, cancelParams{ID: rawID}, nil); err != nil {
+			log.Printf("Peer.Call() got error while sending %s: %v", cancelMethod, err)
+		}
+		return ctx.Err()
+	}
+}
+
+// Notify sends method/params as a JSON-RPC 2.0 notification (no id, no reply expected).
+func (p *Peer) Notify(method string, params interface{}) error {
+	return p.send(method, params, nil)
+}
+
+func (p *Peer) send(method string, params interface{}, id json.RawMessage) error {
+	var rawParams json.RawMessage
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		rawParams = b
+	}
+	return p.OutEncoder.Encode(rpcRequest{JSONRPC: "2.0", Method: method, Params: rawParams, ID: id})
+}
+
+// Serve runs the Peer until InDecoder returns an unrecoverable error (io.EOF or
+// io.ErrUnexpectedEOF), dispatching each incoming request/notification to its handler and
+// delivering each incoming reply to the Call waiting on its id.
+func (p *Peer) Serve() (reterr error) {
+	for {
+		var env peerEnvelope
+		err := p.InDecoder.Decode(&env)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			reterr = err
+			break
+		} else if err != nil {
+			log.Printf("Peer.Serve() got error while decoding input: %v", err)
+			continue
+		}
+
+		if env.Method == "" {
+			p.deliverResponse(env)
+			continue
+		}
+
+		p.wg.Add(1)
+		go func(env peerEnvelope) {
+			defer p.wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					st := debug.Stack()
+					log.Printf("Caught panic in Peer.Serve(): %v\n%s", r, st)
+				}
+			}()
+			p.handleIncoming(env)
+		}(env)
+	}
+	return
+}
+
+func (p *Peer) deliverResponse(env peerEnvelope) {
+	var id string
+	if err := json.Unmarshal(env.ID, &id); err != nil {
+		log.Printf("Peer.Serve() got reply with unparsable id: %v", err)
+		return
+	}
+
+	p.mu.Lock()
+	ch, found := p.pending[id]
+	p.mu.Unlock()
+	if found {
+		ch <- rpcResponse{JSONRPC: env.JSONRPC, Result: env.Result, Error: env.Error, ID: env.ID}
+	}
+}
+
+func (p *Peer) handleIncoming(env peerEnvelope) {
+	if env.Method == cancelMethod {
+		var cp cancelParams
+		if err := json.Unmarshal(env.Params, &cp); err != nil {
+			log.Printf("Peer.Serve() got unparsable %s: %v", cancelMethod, err)
+			return
+		}
+		var id string
+		if err := json.Unmarshal(cp.ID, &id); err != nil {
+			log.Printf("Peer.Serve() got %s with unparsable id: %v", cancelMethod, err)
+			return
+		}
+		p.cancel(id)
+		return
+	}
+
+	isNotification := len(env.ID) == 0
+
+	p.mu.Lock()
+	h, found := p.handlers[env.Method]
+	p.mu.Unlock()
+	if !found {
+		if isNotification {
+			return
+		}
+		p.writeResponse(rpcResponse{JSONRPC: "2.0", ID: env.ID, Error: NewRPCError(ErrCodeMethodNotFound, "method not found: "+env.Method, nil)})
+		return
+	}
+
+	ctx := context.Background()
+	if !isNotification {
+		var id string
+		if err := json.Unmarshal(env.ID, &id); err != nil {
+			p.writeResponse(rpcResponse{JSONRPC: "2.0", ID: env.ID, Error: NewRPCError(ErrCodeInvalidRequest, "unparsable id", nil)})
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		p.registerCancel(id, cancel)
+		defer p.releaseCancel(id)
+	}
+
+	result, rpcErr := callRPCHandler(ctx, h, env.Params)
+	if isNotification {
+		return
+	}
+	if rpcErr != nil {
+		p.writeResponse(rpcResponse{JSONRPC: "2.0", ID: env.ID, Error: rpcErr})
+		return
+	}
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		p.writeResponse(rpcResponse{JSONRPC: "2.0", ID: env.ID, Error: NewRPCError(ErrCodeInternalError, err.Error(), nil)})
+		return
+	}
+	p.writeResponse(rpcResponse{JSONRPC: "2.0", ID: env.ID, Result: resultBytes})
+}
+
+func (p *Peer) registerCancel(id string, cancel context.CancelFunc) {
+	p.cancelMu.Lock()
+	defer p.cancelMu.Unlock()
+	if p.cancels == nil {
+		p.cancels = make(map[string]context.CancelFunc)
+	}
+	p.cancels[id] = cancel
+}
+
+// releaseCancel drops the bookkeeping for id's context.CancelFunc. callRPCHandler recovers a
+// panicking handler and reports it as an ErrCodeInternalError, so this always runs as a normal
+// deferred return from handleIncoming and never leaves a stale cancel registration behind.
+func (p *Peer) releaseCancel(id string) {
+	p.cancelMu.Lock()
+	defer p.cancelMu.Unlock()
+	delete(p.cancels, id)
+}
+
+func (p *Peer) cancel(id string) {
+	p.cancelMu.Lock()
+	cancel, found := p.cancels[id]
+	p.cancelMu.Unlock()
+	if found {
+		cancel()
+	}
+}
+
+func (p *Peer) writeResponse(resp rpcResponse) {
+	if err := p.OutEncoder.Encode(resp); err != nil {
+		log.Printf("Peer.Serve() got error while encoding reply: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package stdiocmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+)
+
+func newConnectedPeers() (*Peer, *Peer) {
+	aIn, bOut := io.Pipe()
+	bIn, aOut := io.Pipe()
+
+	a := &Peer{
+		InDecoder:  json.NewDecoder(aIn),
+		OutEncoder: &SyncEncoder{Encoder: json.NewEncoder(aOut)},
+	}
+	b := &Peer{
+		InDecoder:  json.NewDecoder(bIn),
+		OutEncoder: &SyncEncoder{Encoder: json.NewEncoder(bOut)},
+	}
+	return a, b
+}
+
+func TestPeerBidirectionalCall(t *testing.T) {
+
+	a, b := newConnectedPeers()
+
+	a.Register("ping", func(ctx context.Context, p echoParams) (echoResult, error) {
+		return echoResult{Text: "pong"}, nil
+	})
+	b.Register("push", func(ctx context.Context, p echoParams) (echoResult, error) {
+		return echoResult{Text: p.Text}, nil
+	})
+
+	go a.Serve()
+	go b.Serve()
+
+	var fromB echoResult
+	if err := b.Call(context.Background(), "ping", echoParams{}, &fromB); err != nil {
+		t.Fatalf("b.Call(ping) error: %v", err)
+	}
+	if fromB.Text != "pong" {
+		t.Fatalf("expected pong, got %q", fromB.Text)
+	}
+
+	var fromA echoResult
+	if err := a.Call(context.Background(), "push", echoParams{Text: "hello"}, &fromA); err != nil {
+		t.Fatalf("a.Call(push) error: %v", err)
+	}
+	if fromA.Text != "hello" {
+		t.Fatalf("expected hello, got %q", fromA.Text)
+	}
+}
+
+func TestPeerCallHandlerPanicReturnsError(t *testing.T) {
+
+	a, b := newConnectedPeers()
+
+	a.Register("boom", func(ctx context.Context, p echoParams) (echoResult, error) {
+		panic("kaboom")
+	})
+
+	go a.Serve()
+	go b.Serve()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := b.Call(ctx, "boom", echoParams{}, nil)
+	if err == nil {
+		t.Fatal("Call() to panicking handler returned nil error, want an ErrCodeInternalError reply")
+	}
+	rpcErr, ok := err.(*RPCError)
+	if !ok || rpcErr.Code != ErrCodeInternalError {
+		t.Fatalf("Call() error = %v, want an *RPCError with code %d", err, ErrCodeInternalError)
+	}
+}
+
+func TestPeerCallCancellation(t *testing.T) {
+
+	a, b := newConnectedPeers()
+
+	cancelled := make(chan struct{})
+	a.Register("slow", func(ctx context.Context, p echoParams) (echoResult, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return echoResult{}, ctx.Err()
+	})
+
+	go a.Serve()
+	go b.Serve()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Call(ctx, "slow", echoParams{}, nil)
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("b.Call() did not return after cancellation")
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a's handler context was never cancelled")
+	}
+}
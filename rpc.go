@@ -0,0 +1,392 @@
+package stdiocmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// JSON-RPC 2.0 standard error codes, as defined by https://www.jsonrpc.org/specification#error_object
+const (
+	ErrCodeParseError     = -32700
+	ErrCodeInvalidRequest = -32600
+	ErrCodeMethodNotFound = -32601
+	ErrCodeInvalidParams  = -32602
+	ErrCodeInternalError  = -32603
+)
+
+// RPCError is the JSON-RPC 2.0 error object.  It also implements the error interface so it
+// can be returned directly from a registered handler func to control the code/data sent on the wire.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (code %d)", e.Message, e.Code)
+}
+
+// NewRPCError makes an RPCError with the given code and message, suitable for returning from a handler func.
+func NewRPCError(code int, message string, data interface{}) *RPCError {
+	return &RPCError{Code: code, Message: message, Data: data}
+}
+
+// rpcRequest is the wire format for a single JSON-RPC 2.0 request or notification.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+func (r *rpcRequest) isNotification() bool {
+	return len(r.ID) == 0
+}
+
+// rpcResponse is the wire format for a single JSON-RPC 2.0 reply.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// rpcHandlerEntry wraps a func with the reflection-friendly shape required by
+// RPCServer.Register: func(context.Context, ParamsT) (ResultT, error).  ParamsT and ResultT
+// can be any JSON-marshalable type.
+type rpcHandlerEntry struct {
+	fn         reflect.Value
+	paramsType reflect.Type
+}
+
+// RPCServer implements the server side of JSON-RPC 2.0 on top of an InDecoder/OutEncoder pair,
+// the same plumbing MessageServer uses.  Unlike MessageServer's raw fire-and-forget Message map,
+// RPCServer gives callers a real request/response idiom: register typed handler funcs, and
+// RPCServer takes care of decoding params, matching up the reply's id, and reporting the
+// standard JSON-RPC error codes when something goes wrong.
+type RPCServer struct {
+	InDecoder  Decoder
+	OutEncoder Encoder
+
+	mu       sync.Mutex
+	handlers map[string]rpcHandlerEntry
+	wg       sync.WaitGroup
+}
+
+// NewStdRPCServer returns an RPCServer connected to stdin and stdout, framed as line-delimited
+// JSON same as NewStdMessageServer. Use NewStdRPCServerWithCodec for other framings.
+func NewStdRPCServer() *RPCServer {
+	return NewStdRPCServerWithCodec(JSONCodec{})
+}
+
+// NewStdRPCServerWithCodec returns an RPCServer connected to stdin and stdout, framed according
+// to codec.
+func NewStdRPCServerWithCodec(codec Codec) *RPCServer {
+	return &RPCServer{
+		InDecoder:  codec.NewDecoder(os.Stdin),
+		OutEncoder: &SyncEncoder{Encoder: codec.NewEncoder(os.Stdout)},
+	}
+}
+
+// newRPCHandlerEntry validates that fn has the signature func(context.Context, ParamsT)
+// (ResultT, error) and wraps it for later reflect-based dispatch. It panics if fn does not
+// match that shape, since that is a programmer error caught at startup rather than something
+// to recover from at runtime. Shared by RPCServer.Register and Peer.Register.
+func newRPCHandlerEntry(method string, fn interface{}) rpcHandlerEntry {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.NumIn() != 2 || ft.NumOut() != 2 {
+		panic(fmt.Sprintf("stdiocmd: Register(%q, ...): fn must be func(context.Context, ParamsT) (ResultT, error)", method))
+	}
+	var ctxType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	var errType = reflect.TypeOf((*error)(nil)).Elem()
+	if !ft.In(0).Implements(ctxType) || !ft.Out(1).Implements(errType) {
+		panic(fmt.Sprintf("stdiocmd: Register(%q, ...): fn must be func(context.Context, ParamsT) (ResultT, error)", method))
+	}
+	return rpcHandlerEntry{fn: fv, paramsType: ft.In(1)}
+}
+
+// callRPCHandler decodes rawParams into h's params type and invokes it with ctx, translating a
+// returned error into an *RPCError (passing one through as-is, or wrapping any other error as
+// ErrCodeInternalError). A panicking handler is recovered here too, and reported the same way as
+// a returned error, so the caller always gets a reply instead of the request hanging forever.
+// Shared by RPCServer and Peer.
+func callRPCHandler(ctx context.Context, h rpcHandlerEntry, rawParams json.RawMessage) (result interface{}, rpcErr *RPCError) {
+	paramsPtr := reflect.New(h.paramsType)
+	if len(rawParams) > 0 {
+		if err := json.Unmarshal(rawParams, paramsPtr.Interface()); err != nil {
+			return nil, NewRPCError(ErrCodeInvalidParams, err.Error(), nil)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			st := debug.Stack()
+			log.Printf("Caught panic in RPC handler: %v\n%s", r, st)
+			result, rpcErr = nil, NewRPCError(ErrCodeInternalError, fmt.Sprintf("panic: %v", r), nil)
+		}
+	}()
+
+	out := h.fn.Call([]reflect.Value{reflect.ValueOf(ctx), paramsPtr.Elem()})
+	if errVal, _ := out[1].Interface().(error); errVal != nil {
+		if rpcErr, ok := errVal.(*RPCError); ok {
+			return nil, rpcErr
+		}
+		return nil, NewRPCError(ErrCodeInternalError, errVal.Error(), nil)
+	}
+	return out[0].Interface(), nil
+}
+
+// Register adds a handler for method, which must be a func with the signature
+// func(context.Context, ParamsT) (ResultT, error).  It panics if fn does not match that shape,
+// since that is a programmer error caught at startup rather than something to recover from at runtime.
+func (s *RPCServer) Register(method string, fn interface{}) {
+	h := newRPCHandlerEntry(method, fn)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[string]rpcHandlerEntry)
+	}
+	s.handlers[method] = h
+}
+
+// Wait blocks until all goroutines started by Serve() have exited.
+func (s *RPCServer) Wait() {
+	s.wg.Wait()
+}
+
+// Serve runs the RPCServer until InDecoder returns an unrecoverable error (io.EOF or
+// io.ErrUnexpectedEOF), decoding one JSON-RPC request (or batch array of requests) at a time
+// and dispatching it to the registered handler.
+func (s *RPCServer) Serve() (reterr error) {
+	for {
+		var raw json.RawMessage
+		err := s.InDecoder.Decode(&raw)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			reterr = err
+			break
+		} else if err != nil {
+			log.Printf("RPCServer.Serve() got error while decoding input: %v", err)
+			continue
+		}
+
+		s.wg.Add(1)
+		go func(raw json.RawMessage) {
+			defer s.wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					st := debug.Stack()
+					log.Printf("Caught panic in RPCServer.Serve(): %v\n%s", r, st)
+				}
+			}()
+			s.handleRaw(raw)
+		}(raw)
+	}
+	return
+}
+
+func (s *RPCServer) handleRaw(raw json.RawMessage) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return
+	}
+
+	if trimmed[0] == '[' {
+		var rawReqs []json.RawMessage
+		if err := json.Unmarshal(trimmed, &rawReqs); err != nil {
+			s.writeResponse(rpcResponse{JSONRPC: "2.0", Error: NewRPCError(ErrCodeParseError, err.Error(), nil)})
+			return
+		}
+		if len(rawReqs) == 0 {
+			s.writeResponse(rpcResponse{JSONRPC: "2.0", Error: NewRPCError(ErrCodeInvalidRequest, "empty batch", nil)})
+			return
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var replies []rpcResponse
+		for _, rawReq := range rawReqs {
+			wg.Add(1)
+			go func(rawReq json.RawMessage) {
+				defer wg.Done()
+				defer func() {
+					if r := recover(); r != nil {
+						st := debug.Stack()
+						log.Printf("Caught panic in RPCServer.Serve() batch dispatch: %v\n%s", r, st)
+					}
+				}()
+				if resp, ok := s.handleOne(rawReq); ok {
+					mu.Lock()
+					replies = append(replies, resp)
+					mu.Unlock()
+				}
+			}(rawReq)
+		}
+		wg.Wait()
+
+		if len(replies) == 0 {
+			return
+		}
+		if err := s.OutEncoder.Encode(replies); err != nil {
+			log.Printf("RPCServer.Serve() got error while encoding batch reply: %v", err)
+		}
+		return
+	}
+
+	if resp, ok := s.handleOne(trimmed); ok {
+		s.writeResponse(resp)
+	}
+}
+
+// handleOne decodes and dispatches a single (non-batch) request, returning the response to
+// send back and whether one should be sent at all (notifications get no reply).
+func (s *RPCServer) handleOne(raw json.RawMessage) (rpcResponse, bool) {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return rpcResponse{JSONRPC: "2.0", Error: NewRPCError(ErrCodeParseError, err.Error(), nil)}, true
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		if req.isNotification() {
+			return rpcResponse{}, false
+		}
+		return rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: NewRPCError(ErrCodeInvalidRequest, "invalid request", nil)}, true
+	}
+
+	s.mu.Lock()
+	h, found := s.handlers[req.Method]
+	s.mu.Unlock()
+	if !found {
+		if req.isNotification() {
+			return rpcResponse{}, false
+		}
+		return rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: NewRPCError(ErrCodeMethodNotFound, fmt.Sprintf("method not found: %s", req.Method), nil)}, true
+	}
+
+	result, rpcErr := callRPCHandler(context.Background(), h, req.Params)
+	if req.isNotification() {
+		return rpcResponse{}, false
+	}
+	if rpcErr != nil {
+		return rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}, true
+	}
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: NewRPCError(ErrCodeInternalError, err.Error(), nil)}, true
+	}
+	return rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: resultBytes}, true
+}
+
+func (s *RPCServer) writeResponse(resp rpcResponse) {
+	if err := s.OutEncoder.Encode(resp); err != nil {
+		log.Printf("RPCServer.Serve() got error while encoding reply: %v", err)
+	}
+}
+
+// RPCClient implements the client side of JSON-RPC 2.0: Call sends a request and blocks until
+// the matching reply arrives (correlated by id), and Notify sends a fire-and-forget notification.
+// Serve, which callers run in its own goroutine, reads replies off InDecoder and delivers them to
+// whichever Call is waiting on that id.
+type RPCClient struct {
+	InDecoder  Decoder
+	OutEncoder Encoder
+
+	nextID  int64
+	mu      sync.Mutex
+	pending map[string]chan rpcResponse
+}
+
+// Call sends method/params as a JSON-RPC 2.0 request and blocks until a reply with the matching
+// id is read by Serve, unmarshaling the result into result (which should be a pointer, as with
+// json.Unmarshal). It returns the *RPCError from the reply, if any, as an error.
+func (c *RPCClient) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	id := strconv.FormatInt(atomic.AddInt64(&c.nextID, 1), 10)
+	ch := make(chan rpcResponse, 1)
+
+	c.mu.Lock()
+	if c.pending == nil {
+		c.pending = make(map[string]chan rpcResponse)
+	}
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(method, params, json.RawMessage(strconv.Quote(id))); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notify sends method/params as a JSON-RPC 2.0 notification (no id, no reply expected).
+func (c *RPCClient) Notify(method string, params interface{}) error {
+	return c.send(method, params, nil)
+}
+
+func (c *RPCClient) send(method string, params interface{}, id json.RawMessage) error {
+	var rawParams json.RawMessage
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		rawParams = b
+	}
+	return c.OutEncoder.Encode(rpcRequest{JSONRPC: "2.0", Method: method, Params: rawParams, ID: id})
+}
+
+// Serve reads replies off InDecoder and delivers each one to the Call waiting on its id, until
+// InDecoder returns an unrecoverable error (io.EOF or io.ErrUnexpectedEOF).
+func (c *RPCClient) Serve() (reterr error) {
+	for {
+		var resp rpcResponse
+		err := c.InDecoder.Decode(&resp)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			reterr = err
+			break
+		} else if err != nil {
+			log.Printf("RPCClient.Serve() got error while decoding input: %v", err)
+			continue
+		}
+
+		var id string
+		if err := json.Unmarshal(resp.ID, &id); err != nil {
+			log.Printf("RPCClient.Serve() got reply with unparsable id: %v", err)
+			continue
+		}
+
+		c.mu.Lock()
+		ch, found := c.pending[id]
+		c.mu.Unlock()
+		if found {
+			ch <- resp
+		}
+	}
+	return
+}
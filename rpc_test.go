@@ -0,0 +1,164 @@
+package stdiocmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type echoParams struct {
+	Text string `json:"text"`
+}
+
+type echoResult struct {
+	Text string `json:"text"`
+}
+
+func TestRPCServer(t *testing.T) {
+
+	s := &RPCServer{}
+	s.Register("echo", func(ctx context.Context, p echoParams) (echoResult, error) {
+		return echoResult{Text: p.Text}, nil
+	})
+	s.Register("boom", func(ctx context.Context, p echoParams) (echoResult, error) {
+		return echoResult{}, NewRPCError(ErrCodeInvalidParams, "boom", nil)
+	})
+
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","method":"echo","params":{"text":"hello"},"id":1}`,
+		`{"jsonrpc":"2.0","method":"nope","params":{},"id":2}`,
+		`{"jsonrpc":"2.0","method":"boom","params":{},"id":3}`,
+		`{"jsonrpc":"2.0","method":"echo","params":{"text":"ignored"}}`,
+		``,
+	}, "\n")
+
+	var outBuf bytes.Buffer
+	s.InDecoder = json.NewDecoder(bytes.NewReader([]byte(in)))
+	s.OutEncoder = &SyncEncoder{Encoder: json.NewEncoder(&outBuf)}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.Serve()
+		s.Wait()
+	}()
+	wg.Wait()
+
+	out := outBuf.String()
+	if !strings.Contains(out, `"result":{"text":"hello"}`) {
+		t.Fatalf("missing echo result in output: %s", out)
+	}
+	if !strings.Contains(out, `"code":-32601`) {
+		t.Fatalf("missing method-not-found error in output: %s", out)
+	}
+	if !strings.Contains(out, `"code":-32602`) {
+		t.Fatalf("missing invalid-params error in output: %s", out)
+	}
+	if strings.Contains(out, `"ignored"`) {
+		t.Fatalf("notification should not produce a reply, got: %s", out)
+	}
+}
+
+func TestRPCServerHandlerPanicRecovered(t *testing.T) {
+
+	s := &RPCServer{}
+	s.Register("boom", func(ctx context.Context, p echoParams) (echoResult, error) {
+		panic("kaboom")
+	})
+	s.Register("echo", func(ctx context.Context, p echoParams) (echoResult, error) {
+		return echoResult{Text: p.Text}, nil
+	})
+
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","method":"boom","params":{},"id":1}`,
+		`{"jsonrpc":"2.0","method":"echo","params":{"text":"still alive"},"id":2}`,
+		``,
+	}, "\n")
+
+	var outBuf bytes.Buffer
+	s.InDecoder = json.NewDecoder(bytes.NewReader([]byte(in)))
+	s.OutEncoder = &SyncEncoder{Encoder: json.NewEncoder(&outBuf)}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.Serve()
+		s.Wait()
+	}()
+	wg.Wait()
+
+	out := outBuf.String()
+	if !strings.Contains(out, `"still alive"`) {
+		t.Fatalf("panicking handler took down the rest of Serve(): %s", out)
+	}
+	if !strings.Contains(out, `"id":1`) || !strings.Contains(out, `"code":-32603`) {
+		t.Fatalf("panicking request got no internal-error reply: %s", out)
+	}
+}
+
+func TestRPCServerBatch(t *testing.T) {
+
+	s := &RPCServer{}
+	s.Register("echo", func(ctx context.Context, p echoParams) (echoResult, error) {
+		return echoResult{Text: p.Text}, nil
+	})
+
+	in := `[{"jsonrpc":"2.0","method":"echo","params":{"text":"a"},"id":1},{"jsonrpc":"2.0","method":"echo","params":{"text":"b"},"id":2}]` + "\n"
+
+	var outBuf bytes.Buffer
+	s.InDecoder = json.NewDecoder(bytes.NewReader([]byte(in)))
+	s.OutEncoder = &SyncEncoder{Encoder: json.NewEncoder(&outBuf)}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.Serve()
+		s.Wait()
+	}()
+	wg.Wait()
+
+	var replies []rpcResponse
+	if err := json.Unmarshal(bytes.TrimSpace(outBuf.Bytes()), &replies); err != nil {
+		t.Fatalf("batch reply was not a JSON array: %v (%s)", err, outBuf.String())
+	}
+	if len(replies) != 2 {
+		t.Fatalf("expected 2 replies, got %d", len(replies))
+	}
+}
+
+func TestRPCClientCall(t *testing.T) {
+
+	s := &RPCServer{}
+	s.Register("echo", func(ctx context.Context, p echoParams) (echoResult, error) {
+		return echoResult{Text: p.Text}, nil
+	})
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	s.InDecoder = json.NewDecoder(serverIn)
+	s.OutEncoder = json.NewEncoder(serverOut)
+
+	c := &RPCClient{
+		InDecoder:  json.NewDecoder(clientIn),
+		OutEncoder: json.NewEncoder(clientOut),
+	}
+
+	go s.Serve()
+	go c.Serve()
+
+	var result echoResult
+	if err := c.Call(context.Background(), "echo", echoParams{Text: "hi"}, &result); err != nil {
+		t.Fatalf("Call() returned error: %v", err)
+	}
+	if result.Text != "hi" {
+		t.Fatalf("expected result.Text to be %q, got %q", "hi", result.Text)
+	}
+}
@@ -6,7 +6,6 @@
 package stdiocmd
 
 import (
-	"encoding/json"
 	"io"
 	"log"
 	"os"
@@ -65,13 +64,22 @@ func (f MessageHandlerFunc) HandleMessage(w MessageWriter, m Message) {
 	f(w, m)
 }
 
-// NewStdMessageServer returns a Message server connected to stdin and stdout.
+// NewStdMessageServer returns a Message server connected to stdin and stdout, framed as
+// line-delimited JSON. It is equivalent to NewStdMessageServerWithCodec(h, JSONCodec{}).
 func NewStdMessageServer(h MessageHandler) *MessageServer {
+	return NewStdMessageServerWithCodec(h, JSONCodec{})
+}
+
+// NewStdMessageServerWithCodec returns a Message server connected to stdin and stdout, framed
+// according to codec. Use this instead of NewStdMessageServer when stdio may interleave plain
+// log lines with the message stream (with LSPCodec), or to use another framing such as
+// LengthPrefixedCodec.
+func NewStdMessageServerWithCodec(h MessageHandler, codec Codec) *MessageServer {
 	return &MessageServer{
 		// decode from stdin
-		InDecoder: json.NewDecoder(os.Stdin),
+		InDecoder: codec.NewDecoder(os.Stdin),
 		// wrap stdout with a SyncEncoder to ensure multiple writes don't interleave.
-		OutEncoder: &SyncEncoder{Encoder: json.NewEncoder(os.Stdout)},
+		OutEncoder: &SyncEncoder{Encoder: codec.NewEncoder(os.Stdout)},
 		//
 		MessageHandler: h,
 	}